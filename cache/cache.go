@@ -0,0 +1,106 @@
+// Package cache memoizes a sloc scan of a directory, keyed by a dirhash of
+// its contents so the cache stays correct across git checkout, reflinks,
+// and plain file copies without relying on mtime.
+package cache
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// Item is the cached shape of a single counted file.
+type Item struct {
+	Path     string `json:"path"`
+	Lang     string `json:"lang"`
+	Code     int    `json:"code"`
+	Comments int    `json:"comments"`
+	Blanks   int    `json:"blanks"`
+	Physical int    `json:"physical"`
+}
+
+// Entry is a full cached scan result for one directory hash.
+type Entry struct {
+	Hash       string `json:"hash"`
+	Items      []Item `json:"items"`
+	Total      int    `json:"total"`
+	PathMaxLen int    `json:"path_max_len"`
+}
+
+// Hash computes a dirhash "h1:" content hash over files (relative,
+// slash-separated paths under root), the same way go.sum hashes modules:
+// sort the files, hash each one's contents, then hash the sorted
+// "hash  path\n" listing.
+func Hash(root string, files []string) (string, error) {
+	return dirhash.Hash1(files, func(name string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(root, filepath.FromSlash(name)))
+	})
+}
+
+// Dir returns the sloc cache directory, creating it if necessary.
+func Dir() (string, error) {
+	base := os.Getenv("XDG_CACHE_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, ".cache")
+	}
+
+	dir := filepath.Join(base, "sloc")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// Load returns the cached entry for hash, if one exists.
+func Load(hash string) (Entry, bool, error) {
+	dir, err := Dir()
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, fileName(hash)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Entry{}, false, nil
+		}
+		return Entry{}, false, err
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return Entry{}, false, err
+	}
+
+	return entry, true, nil
+}
+
+// Store persists entry under its own Hash.
+func Store(entry Entry) error {
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, fileName(entry.Hash)), b, 0o644)
+}
+
+var fileNameReplacer = strings.NewReplacer(":", "_", "/", "_", "+", "-")
+
+// fileName turns a "h1:base64..." hash into a safe cache file name.
+func fileName(hash string) string {
+	return fileNameReplacer.Replace(hash) + ".json"
+}
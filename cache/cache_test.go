@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Hash_stableAcrossCopies(t *testing.T) {
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "a.go"), []byte("package a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dst, "a.go"), []byte("package a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	h1, err := Hash(src, []string{"a.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := Hash(dst, []string{"a.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h1 != h2 {
+		t.Errorf("Hash() differed across copies with identical contents: %q vs %q", h1, h2)
+	}
+
+	if err := os.WriteFile(filepath.Join(dst, "a.go"), []byte("package a\n\nvar x = 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	h3, err := Hash(dst, []string{"a.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h3 == h1 {
+		t.Error("Hash() did not change after file contents changed")
+	}
+}
+
+func Test_Load_Store(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	entry := Entry{
+		Hash:       "h1:deadbeef",
+		Items:      []Item{{Path: "a.go", Lang: "go", Code: 3, Physical: 3}},
+		Total:      3,
+		PathMaxLen: 4,
+	}
+
+	if err := Store(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok, err := Load(entry.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("Load() reported no cache entry after Store()")
+	}
+	if got.Total != entry.Total || len(got.Items) != 1 || got.Items[0].Path != "a.go" {
+		t.Errorf("Load() = %+v, want %+v", got, entry)
+	}
+
+	if _, ok, err := Load("h1:neverstored"); err != nil || ok {
+		t.Errorf("Load() of unknown hash = (ok=%v, err=%v), want (false, nil)", ok, err)
+	}
+}
@@ -0,0 +1,245 @@
+// Package ignore implements gitignore-style path matching: it discovers
+// .gitignore files at each directory level of a tree (plus an optional
+// .slocignore at the root) and answers whether a given path should be
+// skipped.
+package ignore
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// alwaysSkip holds VCS internals that .gitignore discovery never descends
+// into: there's nothing to find under them, and on a large tree (a fat
+// .git) walking in anyway defeats the point of the cache
+// and worker-pool walk sitting on top of this package.
+var alwaysSkip = []string{".git"}
+
+// Matcher answers whether a path under its root should be ignored, based on
+// the patterns collected from every .gitignore (and the root .slocignore)
+// found while walking the tree.
+type Matcher struct {
+	root string
+	dirs map[string][]rule // slash-separated dir relative to root ("" for root) -> its rules, in file order
+}
+
+type rule struct {
+	negate   bool
+	dirOnly  bool
+	anchored bool
+	re       *regexp.Regexp
+}
+
+// Empty builds a Matcher for root with no rules, for callers that skip
+// .gitignore/.slocignore discovery but still want to add ad-hoc patterns
+// via AddPatterns.
+func Empty(root string) *Matcher {
+	return &Matcher{root: root, dirs: map[string][]rule{}}
+}
+
+// New builds a Matcher for root, reading root/.slocignore and every
+// .gitignore found while walking root. It doesn't descend into alwaysSkip
+// directories or any directory already ignored by the rules collected so
+// far, since nothing under an ignored directory can apply (gitignore has
+// no way to un-ignore a file whose parent directory is excluded).
+func New(root string) (*Matcher, error) {
+	m := &Matcher{root: root, dirs: map[string][]rule{}}
+
+	rules, err := readRules(filepath.Join(root, ".slocignore"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	m.dirs[""] = append(m.dirs[""], rules...)
+
+	err = filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			rel = ""
+		}
+		rel = filepath.ToSlash(rel)
+
+		if rel != "" && (slices.Contains(alwaysSkip, d.Name()) || m.Match(rel, true)) {
+			return filepath.SkipDir
+		}
+
+		rules, err := readRules(filepath.Join(p, ".gitignore"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		m.dirs[rel] = append(m.dirs[rel], rules...)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// AddPatterns compiles patterns as additional root-scoped rules, used for
+// the ad-hoc entries passed via -i.
+func (m *Matcher) AddPatterns(patterns []string) {
+	for _, p := range patterns {
+		if r, ok := compile(p); ok {
+			m.dirs[""] = append(m.dirs[""], r)
+		}
+	}
+}
+
+// Match reports whether p (slash- or OS-separated, relative to the
+// matcher's root) should be ignored. isDir must reflect whether p is a
+// directory, since directory-only patterns (a trailing "/") only apply to
+// directories.
+func (m *Matcher) Match(p string, isDir bool) bool {
+	p = filepath.ToSlash(p)
+
+	parentDir := path.Dir(p)
+	if parentDir == "." {
+		parentDir = ""
+	}
+
+	ignored := false
+	dir := ""
+	for {
+		rel := p
+		if dir != "" {
+			rel = strings.TrimPrefix(p, dir+"/")
+		}
+
+		for _, r := range m.dirs[dir] {
+			if r.matches(rel, isDir) {
+				ignored = !r.negate
+			}
+		}
+
+		if dir == parentDir {
+			break
+		}
+
+		idx := strings.Index(rel, "/")
+		if idx < 0 {
+			break
+		}
+		if dir == "" {
+			dir = rel[:idx]
+		} else {
+			dir = dir + "/" + rel[:idx]
+		}
+	}
+
+	return ignored
+}
+
+func (r rule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	target := rel
+	if !r.anchored {
+		target = path.Base(rel)
+	}
+
+	return r.re.MatchString(target)
+}
+
+func readRules(path string) ([]rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []rule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if r, ok := compile(scanner.Text()); ok {
+			rules = append(rules, r)
+		}
+	}
+
+	return rules, scanner.Err()
+}
+
+// compile turns one gitignore-format line into a rule. It reports false for
+// blank lines and comments.
+func compile(line string) (rule, bool) {
+	line = strings.TrimRight(line, " \t")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule{}, false
+	}
+
+	var r rule
+
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if strings.HasPrefix(line, "/") {
+		r.anchored = true
+		line = line[1:]
+	}
+	if strings.Contains(line, "/") {
+		r.anchored = true
+	}
+
+	r.re = regexp.MustCompile("^" + globToRegex(line) + "$")
+
+	return r, true
+}
+
+// globToRegex translates a gitignore glob (*, ?, and the "**" directory
+// wildcard) into the equivalent regular expression.
+func globToRegex(glob string) string {
+	var b strings.Builder
+
+	i := 0
+	for i < len(glob) {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 3
+		case strings.HasPrefix(glob[i:], "/**"):
+			b.WriteString("(/.*)?")
+			i += 3
+		case glob[i:] == "**":
+			b.WriteString(".*")
+			i += 2
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+			i++
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+			i++
+		default:
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			i++
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,122 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_Matcher(t *testing.T) {
+	root := t.TempDir()
+
+	writeFile(t, filepath.Join(root, ".gitignore"), strings.Join([]string{
+		"*.log",
+		"/build",
+		"node_modules/",
+		"!important.log",
+	}, "\n"))
+	writeFile(t, filepath.Join(root, "src", ".gitignore"), "generated.go\n")
+
+	m, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"debug.log", false, true},
+		{"important.log", false, false}, // negated back in
+		{"build", true, true},
+		{"src/build", true, false}, // "/build" is anchored to root
+		{"node_modules", true, true},
+		{"vendor/node_modules", true, true}, // unanchored dir pattern matches at any depth
+		{"src/generated.go", false, true},
+		{"generated.go", false, false}, // src/.gitignore only applies under src
+		{"src/main.go", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := m.Match(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("Match(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Matcher_slocignore(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, ".slocignore"), "*.generated.go\n")
+
+	m, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !m.Match("foo.generated.go", false) {
+		t.Error("expected foo.generated.go to be ignored via .slocignore")
+	}
+}
+
+func Test_Empty_AddPatterns(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("tracked\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := Empty(dir)
+	m.AddPatterns([]string{"scratch"})
+
+	if m.Match("tracked", false) {
+		t.Error("Empty() should not read .gitignore, but \"tracked\" was matched")
+	}
+	if !m.Match("scratch", false) {
+		t.Error("expected scratch to be ignored after AddPatterns")
+	}
+}
+
+func Test_New_skipsIgnoredDirs(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, ".gitignore"), "node_modules/\n")
+	writeFile(t, filepath.Join(root, "node_modules", "pkg", ".gitignore"), "whatever\n")
+	writeFile(t, filepath.Join(root, ".git", "objects", ".gitignore"), "whatever\n")
+
+	m, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := m.dirs["node_modules/pkg"]; ok {
+		t.Error("New() descended into an ignored directory and read its .gitignore")
+	}
+	if _, ok := m.dirs[".git/objects"]; ok {
+		t.Error("New() descended into .git and read its .gitignore")
+	}
+}
+
+func Test_Matcher_AddPatterns(t *testing.T) {
+	m, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.AddPatterns([]string{"scratch"})
+
+	if !m.Match("scratch", true) {
+		t.Error("expected scratch to be ignored after AddPatterns")
+	}
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+)
+
+// commentPair is one block-comment delimiter pair, e.g. ("/*", "*/").
+type commentPair struct {
+	start string
+	end   string
+}
+
+type langInfo struct {
+	name      string
+	inline    []string      // line-comment prefixes, tried longest-first
+	blocks    []commentPair // block-comment delimiter pairs
+	nested    bool          // whether block comments of this language nest
+	icon      string
+	color     string
+	strDelims []string // string delimiters, tried longest-first
+	escape    byte     // escape char recognized inside string literals, 0 if none
+	shebangs  []string // interpreter names that identify this language from a #! line
+}
+
+// builtinLanguages is the language table sloc ships with. loadLanguages
+// layers config files on top of a copy of it.
+var builtinLanguages = map[string]langInfo{
+	".c":    {"c", []string{"//"}, []commentPair{{"/*", "*/"}}, false, " ", none, []string{"\"", "'"}, '\\', nil},
+	".css":  {"css", nil, []commentPair{{"/*", "*/"}}, false, " ", blue, []string{"\"", "'"}, '\\', nil},
+	".go":   {"go", []string{"//"}, []commentPair{{"/*", "*/"}}, false, " ", cyan, []string{"`", "\"", "'"}, '\\', nil},
+	".h":    {"h", []string{"//"}, []commentPair{{"/*", "*/"}}, false, " ", blue, []string{"\"", "'"}, '\\', nil},
+	".html": {"html", nil, []commentPair{{"<!--", "-->"}}, false, " ", red, []string{"\"", "'"}, '\\', nil},
+	".js":   {"js", []string{"//"}, []commentPair{{"/*", "*/"}}, false, " ", yellow, []string{"`", "\"", "'"}, '\\', nil},
+	".jsx":  {"jsx", []string{"//"}, []commentPair{{"/*", "*/"}}, false, " ", cyan, []string{"`", "\"", "'"}, '\\', nil}, // TODO: comments within JSX blocks
+	".lua":  {"lua", []string{"--"}, []commentPair{{"--[[", "]]"}}, false, " ", blue, []string{"\"", "'"}, '\\', nil},
+	".py":   {"py", []string{"#"}, nil, false, " ", yellow, []string{"\"\"\"", "'''", "\"", "'"}, '\\', []string{"python", "python3"}},
+	".scm":  {"scm", []string{";"}, nil, false, " ", none, []string{"\""}, '\\', nil},
+	".scss": {"scss", []string{"//"}, []commentPair{{"/*", "*/"}}, false, " ", magenta, []string{"\"", "'"}, '\\', nil},
+	".sh":   {"sh", []string{"#"}, nil, false, " ", green, []string{"\"", "'"}, '\\', []string{"sh", "bash"}},
+	".tex":  {"tex", []string{"%"}, nil, false, " ", none, nil, 0, nil},
+	".ts":   {"ts", []string{"//"}, []commentPair{{"/*", "*/"}}, false, " ", blue, []string{"`", "\"", "'"}, '\\', nil},
+	".tsx":  {"tsx", []string{"//"}, []commentPair{{"/*", "*/"}}, false, " ", blue, []string{"`", "\"", "'"}, '\\', nil},
+	".vim":  {"vim", []string{"\""}, nil, false, " ", green, []string{"'"}, 0, nil},
+	".zsh":  {"zsh", []string{"#"}, nil, false, " ", green, []string{"\"", "'"}, '\\', []string{"zsh"}},
+}
+
+// supported is the effective language table, keyed by extension (including
+// the leading "."). main replaces it with loadLanguages' result once flags
+// are parsed; tests use the built-in default.
+var supported = builtinLanguages
+
+// colorEnabled gates ANSI escapes emitted by icon and the table encoder. It
+// is set once in main from -no-color and whether stdout is a terminal.
+var colorEnabled = true
+
+// langTableHash returns a content hash of table, so callers (the scan
+// cache) can tell whether the effective language definitions have changed
+// since a cached result was written. fmt's "%#v" verb visits map keys in
+// sorted order, so the result is deterministic regardless of map iteration
+// or the order -L config files were merged in.
+func langTableHash(table map[string]langInfo) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%#v", table)))
+	return hex.EncodeToString(sum[:])
+}
+
+func icon(ext string) string {
+	lang, ok := supported[ext]
+	if !ok {
+		return "   "
+	}
+
+	if !colorEnabled {
+		return lang.icon + " "
+	}
+
+	return lang.color + lang.icon + " " + reset
+}
+
+var errUnsupportedFiletype = errors.New("unsupported filetype")
+
+// langForShebang resolves the langInfo for an extensionless script by
+// matching an interpreter name on its #! line.
+func langForShebang(content []byte) (langInfo, bool) {
+	nl := strings.IndexByte(string(content), '\n')
+	line := string(content)
+	if nl >= 0 {
+		line = line[:nl]
+	}
+	if !strings.HasPrefix(line, "#!") {
+		return langInfo{}, false
+	}
+
+	for _, lang := range supported {
+		for _, shebang := range lang.shebangs {
+			if strings.Contains(line, shebang) {
+				return lang, true
+			}
+		}
+	}
+
+	return langInfo{}, false
+}
+
+// lineState is the lexical state of the byte-by-byte scan performed by
+// codeLines.
+type lineState int
+
+const (
+	stateCode lineState = iota
+	stateLineComment
+	stateBlockComment
+	stateString
+)
+
+// lineKind classifies one physical line of a file for the Code/Comments/
+// Blanks breakdown: lineCode if it has at least one byte of real code
+// (including string literals), lineComment if it has content but none of
+// it is code, lineBlank if the line is empty or all whitespace.
+type lineKind int
+
+const (
+	lineBlank lineKind = iota
+	lineComment
+	lineCode
+)
+
+// codeLines walks content byte by byte, tracking whether each line is
+// inside code, a line comment, a block comment, or a string literal, and
+// classifies every line (split on '\n') as code, comment, or blank (code
+// tokens and string literals both count as code; comments and surrounding
+// whitespace don't). This replaces a regex-based stripper that couldn't
+// tell a comment marker inside a string literal from a real comment.
+func codeLines(content string, lang langInfo) []lineKind {
+	var lines []lineKind
+
+	state := stateCode
+	strDelim := ""
+	hasCode := false
+	hasAny := false
+
+	var block commentPair
+	blockDepth := 0
+
+	push := func() {
+		switch {
+		case hasCode:
+			lines = append(lines, lineCode)
+		case hasAny:
+			lines = append(lines, lineComment)
+		default:
+			lines = append(lines, lineBlank)
+		}
+		hasCode = false
+		hasAny = false
+	}
+
+	i := 0
+	for i < len(content) {
+		c := content[i]
+
+		if c == '\n' {
+			push()
+			if state == stateLineComment {
+				state = stateCode
+			}
+			i++
+			continue
+		}
+
+		if !unicode.IsSpace(rune(c)) {
+			hasAny = true
+		}
+
+		switch state {
+		case stateLineComment:
+			i++
+
+		case stateBlockComment:
+			switch {
+			case lang.nested && strings.HasPrefix(content[i:], block.start):
+				blockDepth++
+				i += len(block.start)
+			case strings.HasPrefix(content[i:], block.end):
+				blockDepth--
+				i += len(block.end)
+				if blockDepth == 0 {
+					state = stateCode
+				}
+			default:
+				i++
+			}
+
+		case stateString:
+			hasCode = true
+			switch {
+			// Backtick strings are raw strings (Go) or at least tolerate a
+			// trailing backslash before the closing delimiter (no language
+			// in the table uses "`" as anything but a raw-ish string), so
+			// the language's general escape char never applies to them.
+			case strDelim != "`" && lang.escape != 0 && c == lang.escape && i+1 < len(content) && content[i+1] != '\n':
+				i += 2
+			case strings.HasPrefix(content[i:], strDelim):
+				state = stateCode
+				i += len(strDelim)
+			default:
+				i++
+			}
+
+		case stateCode:
+			if delim, ok := matchDelim(content[i:], lang.strDelims); ok {
+				state = stateString
+				strDelim = delim
+				hasCode = true
+				i += len(delim)
+			} else if pair, ok := matchBlockStart(content[i:], lang.blocks); ok {
+				state = stateBlockComment
+				block = pair
+				blockDepth = 1
+				i += len(pair.start)
+			} else if tok, ok := matchDelim(content[i:], lang.inline); ok {
+				state = stateLineComment
+				i += len(tok)
+			} else {
+				if !unicode.IsSpace(rune(c)) {
+					hasCode = true
+				}
+				i++
+			}
+		}
+	}
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		push()
+	}
+
+	return lines
+}
+
+// matchDelim returns the longest entry in delims that prefixes s.
+func matchDelim(s string, delims []string) (string, bool) {
+	best := ""
+	for _, d := range delims {
+		if d != "" && strings.HasPrefix(s, d) && len(d) > len(best) {
+			best = d
+		}
+	}
+	return best, best != ""
+}
+
+// matchBlockStart returns the pair in blocks whose start delimiter is the
+// longest prefix of s.
+func matchBlockStart(s string, blocks []commentPair) (commentPair, bool) {
+	var best commentPair
+	for _, p := range blocks {
+		if p.start != "" && strings.HasPrefix(s, p.start) && len(p.start) > len(best.start) {
+			best = p
+		}
+	}
+	return best, best.start != ""
+}
+
+// sloc counts filePath's lines by kind and returns the result as an item
+// with its lang and counts populated; the caller fills in path. The
+// extension is checked against supported before anything is read, so the
+// vast majority of non-source files (images, binaries, vendored
+// artifacts) are rejected without ever touching disk; only extensionless
+// files fall back to reading the content to sniff a #! shebang.
+func sloc(filePath string) (item, error) {
+	ext := filepath.Ext(filePath)
+	lang, ok := supported[ext]
+	if !ok && ext != "" {
+		return item{}, fmt.Errorf("%s: %w", filePath, errUnsupportedFiletype)
+	}
+
+	bytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return item{}, fmt.Errorf("%s: failed to read file: %w", filePath, err)
+	}
+
+	if !ok {
+		lang, ok = langForShebang(bytes)
+		if !ok {
+			return item{}, fmt.Errorf("%s: %w", filePath, errUnsupportedFiletype)
+		}
+	}
+
+	it := item{lang: lang.name}
+	for _, kind := range codeLines(string(bytes), lang) {
+		it.physical++
+		switch kind {
+		case lineCode:
+			it.code++
+		case lineComment:
+			it.comments++
+		case lineBlank:
+			it.blanks++
+		}
+	}
+
+	return it, nil
+}
+
+// langConfig is the shape of one [[language]] table in a languages.toml
+// config file.
+type langConfig struct {
+	Name                string     `toml:"name"`
+	Extensions          []string   `toml:"extensions"`
+	LineComment         []string   `toml:"line_comment"`
+	BlockComment        [][]string `toml:"block_comment"`
+	NestedBlockComments bool       `toml:"nested_block_comments"`
+	StringDelims        []string   `toml:"string_delims"`
+	Shebangs            []string   `toml:"shebangs"`
+}
+
+type languagesFile struct {
+	Language []langConfig `toml:"language"`
+}
+
+// loadLanguages returns the effective language table: a copy of
+// builtinLanguages, overridden/extended by whichever of ./.sloc.toml or
+// $XDG_CONFIG_HOME/sloc/languages.toml exists, and then by extraConfig (from
+// -L) if given.
+func loadLanguages(extraConfig string) (map[string]langInfo, error) {
+	table := make(map[string]langInfo, len(builtinLanguages))
+	for ext, lang := range builtinLanguages {
+		table[ext] = lang
+	}
+
+	if path, ok := defaultConfigPath(); ok {
+		if err := applyConfigFile(table, path); err != nil {
+			return nil, err
+		}
+	}
+
+	if extraConfig != "" {
+		if err := applyConfigFile(table, extraConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	return table, nil
+}
+
+func defaultConfigPath() (string, bool) {
+	if _, err := os.Stat(".sloc.toml"); err == nil {
+		return ".sloc.toml", true
+	}
+
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", false
+		}
+		dir = filepath.Join(home, ".config")
+	}
+
+	path := filepath.Join(dir, "sloc", "languages.toml")
+	if _, err := os.Stat(path); err == nil {
+		return path, true
+	}
+
+	return "", false
+}
+
+func applyConfigFile(table map[string]langInfo, path string) error {
+	var file languagesFile
+	if _, err := toml.DecodeFile(path, &file); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	for _, lc := range file.Language {
+		lang, err := langInfoFromConfig(lc)
+		if err != nil {
+			return fmt.Errorf("%s: language %q: %w", path, lc.Name, err)
+		}
+		for _, ext := range lc.Extensions {
+			table[ext] = lang
+		}
+	}
+
+	return nil
+}
+
+func langInfoFromConfig(lc langConfig) (langInfo, error) {
+	blocks := make([]commentPair, 0, len(lc.BlockComment))
+	for _, pair := range lc.BlockComment {
+		if len(pair) != 2 {
+			return langInfo{}, fmt.Errorf("block_comment entries must have exactly 2 elements, got %d", len(pair))
+		}
+		blocks = append(blocks, commentPair{start: pair[0], end: pair[1]})
+	}
+
+	return langInfo{
+		name:      strings.ToLower(lc.Name),
+		inline:    lc.LineComment,
+		blocks:    blocks,
+		nested:    lc.NestedBlockComments,
+		icon:      " ",
+		color:     none,
+		strDelims: lc.StringDelims,
+		escape:    '\\',
+		shebangs:  lc.Shebangs,
+	}, nil
+}
+
+// showLanguages writes the effective language table, one extension per
+// line, sorted for stable -show-languages output.
+func showLanguages(table map[string]langInfo, w *os.File) {
+	exts := make([]string, 0, len(table))
+	for ext := range table {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+
+	for _, ext := range exts {
+		lang := table[ext]
+
+		blocks := make([]string, len(lang.blocks))
+		for i, b := range lang.blocks {
+			blocks[i] = b.start + " " + b.end
+		}
+
+		fmt.Fprintf(w, "%-8s name=%-10s inline=%v block=%v nested=%v strings=%v shebangs=%v\n",
+			ext, lang.name, lang.inline, blocks, lang.nested, lang.strDelims, lang.shebangs)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_codeLines_nestedBlockComments(t *testing.T) {
+	lang := langInfo{
+		inline: []string{"//"},
+		blocks: []commentPair{{"/*", "*/"}},
+		nested: true,
+	}
+
+	content := "fn main() {\n" +
+		"    /* outer /* inner */ still comment */\n" +
+		"    code();\n" +
+		"}\n"
+
+	lines := codeLines(content, lang)
+	want := []lineKind{lineCode, lineComment, lineCode, lineCode}
+	if len(lines) != len(want) {
+		t.Fatalf("codeLines() = %v, want %d lines", lines, len(want))
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d: codeLines() = %v, want %v", i, lines[i], want[i])
+		}
+	}
+}
+
+func Test_codeLines_multipleLineCommentTokens(t *testing.T) {
+	lang := langInfo{inline: []string{"--", "#"}}
+
+	lines := codeLines("select 1 -- sql comment\n# shell-style comment\nselect 2\n", lang)
+	want := []lineKind{lineCode, lineComment, lineCode}
+	if len(lines) != len(want) {
+		t.Fatalf("codeLines() = %v, want %d lines", lines, len(want))
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d: codeLines() = %v, want %v", i, lines[i], want[i])
+		}
+	}
+}
+
+func Test_codeLines_backtickStringsDontEscape(t *testing.T) {
+	lang := langInfo{
+		inline:    []string{"//"},
+		blocks:    []commentPair{{"/*", "*/"}},
+		strDelims: []string{"`", "\"", "'"},
+		escape:    '\\',
+	}
+
+	// A trailing backslash inside a Go raw string is just a literal byte,
+	// not an escape: the backtick on the same line closes the string, so
+	// the next line is a real comment, not still inside it.
+	content := "s := `C:\\Users\\`\n// real comment\nx := 1\n"
+
+	lines := codeLines(content, lang)
+	want := []lineKind{lineCode, lineComment, lineCode}
+	if len(lines) != len(want) {
+		t.Fatalf("codeLines() = %v, want %d lines", lines, len(want))
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d: codeLines() = %v, want %v", i, lines[i], want[i])
+		}
+	}
+}
+
+func Test_langForShebang(t *testing.T) {
+	tests := []struct {
+		content  string
+		wantName string
+		wantOK   bool
+	}{
+		{"#!/usr/bin/env bash\necho hi\n", "sh", true},
+		{"#!/usr/bin/env python3\nprint(1)\n", "py", true},
+		{"echo hi\n", "", false},
+	}
+
+	for _, tt := range tests {
+		lang, ok := langForShebang([]byte(tt.content))
+		if ok != tt.wantOK {
+			t.Errorf("langForShebang(%q) ok = %v, want %v", tt.content, ok, tt.wantOK)
+			continue
+		}
+		if ok && lang.name != tt.wantName {
+			t.Errorf("langForShebang(%q) name = %q, want %q", tt.content, lang.name, tt.wantName)
+		}
+	}
+}
+
+func Test_loadLanguages_override(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	path := filepath.Join(t.TempDir(), "extra.toml")
+	toml := `
+[[language]]
+name = "Rust"
+extensions = [".rs"]
+line_comment = ["//"]
+block_comment = [["/*", "*/"]]
+nested_block_comments = true
+string_delims = ["\""]
+shebangs = ["rust-script"]
+`
+	if err := os.WriteFile(path, []byte(toml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := loadLanguages(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs, ok := table[".rs"]
+	if !ok {
+		t.Fatal("loadLanguages() did not add .rs")
+	}
+	if rs.name != "rust" || !rs.nested || len(rs.blocks) != 1 || rs.blocks[0].start != "/*" {
+		t.Errorf("loadLanguages() .rs = %+v, unexpected shape", rs)
+	}
+
+	if _, ok := table[".go"]; !ok {
+		t.Error("loadLanguages() dropped a built-in language it shouldn't have touched")
+	}
+}
@@ -1,24 +1,31 @@
 package main
 
 import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
-	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"golang.org/x/exp/slices"
+
+	"sloc/cache"
+	"sloc/ignore"
 )
 
-var ignore = []string{
-	"node_modules",
-	"coverage",
-	".git",
-	".next",
-}
+// alwaysIgnore holds VCS internals that are skipped unconditionally, even
+// with -no-ignore, since they're never source to be counted.
+var alwaysIgnore = []string{".git"}
 
 const (
 	none    = "\033[37m"
@@ -31,98 +38,100 @@ const (
 	reset   = "\033[0m"
 )
 
-type langInfo struct {
-	inline string
-	start  string
-	end    string
-	icon   string
-	color  string
-}
-
-var supported = map[string]langInfo{
-	".c":    {"//", "/*", "*/", " ", none},
-	".css":  {"", "/*", "*/", " ", blue},
-	".go":   {"//", "/*", "*/", " ", cyan},
-	".h":    {"//", "/*", "*/", " ", blue},
-	".html": {"", "<!--", "-->", " ", red},
-	".js":   {"//", "/*", "*/", " ", yellow},
-	".jsx":  {"//", "/*", "*/", " ", cyan}, // TODO: comments within JSX blocks
-	".lua":  {"--", "--[[", "]]", " ", blue},
-	".py":   {"#", "\"\"\"", "\"\"\"", " ", yellow},
-	".scm":  {";", "", "", " ", none},
-	".scss": {"//", "/*", "*/", " ", magenta},
-	".sh":   {"#", "", "", " ", green},
-	".tex":  {"%", "", "", " ", none},
-	".ts":   {"//", "/*", "*/", " ", blue},
-	".tsx":  {"//", "/*", "*/", " ", blue},
-	".vim":  {"\"", "", "", " ", green},
-	".zsh":  {"#", "", "", " ", green},
+type item struct {
+	path     string
+	lang     string
+	code     int
+	comments int
+	blanks   int
+	physical int
 }
 
-func icon(ext string) string {
-	lang, ok := supported[ext]
-	if ok {
-		return lang.color + lang.icon + " " + reset
-	}
-
-	return "   "
+// langStat is one row of the per-language summary: item counts aggregated
+// across every file recognized as that language.
+type langStat struct {
+	lang     string
+	files    int
+	code     int
+	comments int
+	blanks   int
+	physical int
 }
 
-var errUnsupportedFiletype = errors.New("unsupported filetype")
-
-func sloc(filePath string) (int, error) {
-	commStr, ok := supported[filepath.Ext(filePath)]
-	if !ok {
-		return 0, fmt.Errorf("%s: %w", filePath, errUnsupportedFiletype)
+// aggregateByLang groups items by language and returns the result sorted by
+// Code descending, the order the per-language summary is conventionally
+// shown in; ties are broken by language name for determinism.
+func aggregateByLang(items []item) []langStat {
+	byLang := map[string]*langStat{}
+	var order []string
+
+	for _, it := range items {
+		s, ok := byLang[it.lang]
+		if !ok {
+			s = &langStat{lang: it.lang}
+			byLang[it.lang] = s
+			order = append(order, it.lang)
+		}
+		s.files++
+		s.code += it.code
+		s.comments += it.comments
+		s.blanks += it.blanks
+		s.physical += it.physical
 	}
 
-	bytes, err := os.ReadFile(filePath)
-	if err != nil {
-		return 0, fmt.Errorf("%s: failed to read file: %w", filePath, err)
+	stats := make([]langStat, len(order))
+	for i, lang := range order {
+		stats[i] = *byLang[lang]
 	}
 
-	content := string(bytes)
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].code != stats[j].code {
+			return stats[i].code > stats[j].code
+		}
+		return stats[i].lang < stats[j].lang
+	})
 
-	start := commStr.start
-	end := commStr.end
+	return stats
+}
 
-	if start != "" && end != "" {
-		pattern := regexp.QuoteMeta(start) + `[\s\S]*?` + regexp.QuoteMeta(end)
-		regex := regexp.MustCompile(pattern)
-		content = regex.ReplaceAllString(content, "")
+// shouldSkip reports whether path, encountered while walking root, should be
+// skipped entirely: either it's a VCS internal directory, or matcher says
+// it's ignored.
+func shouldSkip(root, path string, isDir bool, matcher *ignore.Matcher) (bool, error) {
+	if slices.Contains(alwaysIgnore, filepath.Base(path)) {
+		return true, nil
 	}
 
-	lines := strings.Split(content, "\n")
-
-	total := 0
-
-	for _, line := range lines {
-		trimmedLine := strings.TrimSpace(line)
-
-		if trimmedLine != "" && (commStr.inline == "" || !strings.HasPrefix(trimmedLine, commStr.inline)) {
-			total++
+	if matcher != nil && path != root {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return false, err
+		}
+		if matcher.Match(rel, isDir) {
+			return true, nil
 		}
 	}
 
-	return total, nil
+	return false, nil
 }
 
-type item struct {
-	path string
-	sloc int
-}
-
-func walk(root string) ([]item, int, int, error) {
-	items := []item{}
-	total := 0
-	pathMaxLen := 0
+// collectCandidates lists the relative, slash-separated paths of every
+// regular file under root that survives matcher, sorted lexically. It's the
+// same file set walk's producer feeds to sloc, used on its own so the cache
+// can hash the tree before deciding whether to run sloc at all.
+func collectCandidates(root string, matcher *ignore.Matcher) ([]string, error) {
+	var files []string
 
 	err := filepath.WalkDir(root, func(path string, dirEntry os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if slices.Contains(ignore, filepath.Base(path)) {
+		skip, err := shouldSkip(root, path, dirEntry.IsDir(), matcher)
+		if err != nil {
+			return err
+		}
+		if skip {
 			if dirEntry.IsDir() {
 				return filepath.SkipDir
 			}
@@ -130,30 +139,136 @@ func walk(root string) ([]item, int, int, error) {
 		}
 
 		if dirEntry.Type().IsRegular() && !dirEntry.IsDir() {
-			lines, err := sloc(path)
-			if err != nil && !errors.Is(err, errUnsupportedFiletype) {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
 				return err
 			}
-			// TODO: improve this
-			if !errors.Is(err, errUnsupportedFiletype) {
-				rel, err := filepath.Rel(root, path) // TODO: handle error
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// walk scans root for countable source files and returns their items sorted
+// by path, along with the running total and the longest relative path seen.
+// A single goroutine drives filepath.WalkDir and feeds candidate paths to
+// workers workers, which call sloc and feed the results to a collector. The
+// first error from any goroutine cancels the walk.
+func walk(root string, workers int, matcher *ignore.Matcher) ([]item, int, int, error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	paths := make(chan string)
+	results := make(chan item)
+
+	var failOnce sync.Once
+	var walkErr error
+	fail := func(err error) {
+		failOnce.Do(func() {
+			walkErr = err
+			cancel()
+		})
+	}
+
+	go func() {
+		defer close(paths)
+
+		err := filepath.WalkDir(root, func(path string, dirEntry os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			skip, err := shouldSkip(root, path, dirEntry.IsDir(), matcher)
+			if err != nil {
+				return err
+			}
+			if skip {
+				if dirEntry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if dirEntry.Type().IsRegular() && !dirEntry.IsDir() {
+				select {
+				case paths <- path:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, context.Canceled) {
+			fail(err)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+
+			for path := range paths {
+				it, err := sloc(path)
 				if err != nil {
-					return err
+					if errors.Is(err, errUnsupportedFiletype) {
+						continue
+					}
+					fail(err)
+					return
 				}
-				items = append(items, item{rel, lines})
-				total += lines
-				if l := len(rel); l > pathMaxLen {
-					pathMaxLen = l
+
+				rel, err := filepath.Rel(root, path)
+				if err != nil {
+					fail(err)
+					return
 				}
+				it.path = rel
 
+				select {
+				case results <- it:
+				case <-ctx.Done():
+					return
+				}
 			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	items := []item{}
+	total := 0
+	pathMaxLen := 0
+
+	for it := range results {
+		items = append(items, it)
+		total += it.code
+		if l := len(it.path); l > pathMaxLen {
+			pathMaxLen = l
 		}
-		return nil
-	})
-	if err != nil {
-		return []item{}, 0, 0, err
 	}
 
+	if walkErr != nil {
+		return []item{}, 0, 0, walkErr
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].path < items[j].path })
+
 	return items, total, pathMaxLen, nil
 }
 
@@ -169,42 +284,443 @@ func intlen(n int) int {
 	return count
 }
 
-func print(items []item, total int, pathMaxLen int) {
-	gray := "\033[38;5;8m"
-	reset := "\033[0m"
+// Encoder renders a stream of items to an output format. Items arrive one at
+// a time via WriteItem, the running totals arrive once via WriteTotal once
+// walking is done, WriteLangSummary adds the per-language rollup, and Close
+// flushes and finalizes the output. In -by-lang mode, WriteItem and
+// WriteTotal are skipped entirely and only WriteLangSummary runs.
+type Encoder interface {
+	WriteItem(it item) error
+	WriteTotal(totals item) error
+	WriteLangSummary(stats []langStat) error
+	Close() error
+}
+
+// newEncoder builds the Encoder for format. totals and pathMaxLen size the
+// tableEncoder's borders up front, matching the layout the ANSI table has
+// always used. detailed adds the Comments/Blanks/Physical columns to the
+// table format's per-file rows; byLangOnly omits the per-file section
+// entirely (used by -by-lang).
+func newEncoder(format string, w io.Writer, totals item, pathMaxLen int, detailed, byLangOnly bool) (Encoder, error) {
+	switch format {
+	case "table":
+		return newTableEncoder(w, totals, pathMaxLen, detailed, byLangOnly), nil
+	case "json":
+		return newJSONEncoder(w, byLangOnly), nil
+	case "csv":
+		return newDelimEncoder(w, ',', byLangOnly), nil
+	case "tsv":
+		return newDelimEncoder(w, '\t', byLangOnly), nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// tableEncoder is the original ANSI box-drawn table.
+type tableEncoder struct {
+	w           io.Writer
+	pathMaxLen  int
+	codeLen     int
+	commentsLen int
+	blanksLen   int
+	physicalLen int
+	detailed    bool
+	byLangOnly  bool
+	gray        string
+	reset       string
+}
+
+func newTableEncoder(w io.Writer, totals item, pathMaxLen int, detailed, byLangOnly bool) *tableEncoder {
+	gray, reset := "\033[38;5;8m", "\033[0m"
+	if !colorEnabled {
+		gray, reset = "", ""
+	}
+
+	te := &tableEncoder{
+		w:           w,
+		pathMaxLen:  pathMaxLen,
+		codeLen:     intlen(totals.code),
+		commentsLen: intlen(totals.comments),
+		blanksLen:   intlen(totals.blanks),
+		physicalLen: intlen(totals.physical),
+		detailed:    detailed,
+		byLangOnly:  byLangOnly,
+		gray:        gray,
+		reset:       reset,
+	}
+
+	if !byLangOnly {
+		te.printBorder("┌─", "─┬─", "─┐")
+	}
+
+	return te
+}
+
+func (te *tableEncoder) hLine(n int) string {
+	return strings.Repeat("─", n)
+}
+
+// colWidths returns the width of every column in the per-file table: the
+// path (padded for its leading icon), Code, and — in -detailed mode —
+// Comments, Blanks, and Physical.
+func (te *tableEncoder) colWidths() []int {
+	widths := []int{te.pathMaxLen + 3, te.codeLen}
+	if te.detailed {
+		widths = append(widths, te.commentsLen, te.blanksLen, te.physicalLen)
+	}
+	return widths
+}
+
+func (te *tableEncoder) printBorder(left, mid, right string) {
+	widths := te.colWidths()
+	segs := make([]string, len(widths))
+	for i, wd := range widths {
+		segs[i] = te.hLine(wd)
+	}
+	fmt.Fprintf(te.w, "%s%s%s%s%s\n", te.gray, left, strings.Join(segs, mid), right, te.reset)
+}
+
+func (te *tableEncoder) printRow(path string, code, comments, blanks, physical int) {
+	vLine := te.gray + "│" + te.reset
+
+	pathPad := strings.Repeat(" ", te.pathMaxLen-len(path))
+	displayPath := icon(filepath.Ext(path)) + path
+	fmt.Fprintf(te.w, "%s %s%s %s", vLine, displayPath, pathPad, vLine)
+
+	writeNum := func(n, width int) {
+		pad := strings.Repeat(" ", width-intlen(n))
+		fmt.Fprintf(te.w, " %d%s %s", n, pad, vLine)
+	}
+	writeNum(code, te.codeLen)
+	if te.detailed {
+		writeNum(comments, te.commentsLen)
+		writeNum(blanks, te.blanksLen)
+		writeNum(physical, te.physicalLen)
+	}
+	fmt.Fprint(te.w, "\n")
+}
+
+func (te *tableEncoder) WriteItem(it item) error {
+	te.printRow(it.path, it.code, it.comments, it.blanks, it.physical)
+	return nil
+}
+
+func (te *tableEncoder) WriteTotal(totals item) error {
+	te.printBorder("├─", "─┼─", "─┤")
+	te.printRow("Total", totals.code, totals.comments, totals.blanks, totals.physical)
+	te.printBorder("└─", "─┴─", "─┘")
+	return nil
+}
+
+// WriteLangSummary prints a standalone box below the per-file table (or, in
+// -by-lang mode, the only output) with one row per language sorted by Code
+// descending, plus a Total row.
+func (te *tableEncoder) WriteLangSummary(stats []langStat) error {
+	headers := []string{"Language", "Files", "Code", "Comments", "Blanks", "Physical"}
+	widths := make([]int, len(headers))
+	for i, h := range headers {
+		widths[i] = len(h)
+	}
+
+	var totals langStat
+	rows := make([][]string, len(stats))
+	for i, s := range stats {
+		rows[i] = []string{s.lang, strconv.Itoa(s.files), strconv.Itoa(s.code), strconv.Itoa(s.comments), strconv.Itoa(s.blanks), strconv.Itoa(s.physical)}
+		totals.files += s.files
+		totals.code += s.code
+		totals.comments += s.comments
+		totals.blanks += s.blanks
+		totals.physical += s.physical
+	}
+	totalRow := []string{"Total", strconv.Itoa(totals.files), strconv.Itoa(totals.code), strconv.Itoa(totals.comments), strconv.Itoa(totals.blanks), strconv.Itoa(totals.physical)}
+
+	for _, row := range append(append([][]string{}, rows...), totalRow) {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	border := func(left, mid, right string) {
+		segs := make([]string, len(widths))
+		for i, wd := range widths {
+			segs[i] = te.hLine(wd)
+		}
+		fmt.Fprintf(te.w, "%s%s%s%s%s\n", te.gray, left, strings.Join(segs, mid), right, te.reset)
+	}
+
+	printRow := func(cols []string) {
+		vLine := te.gray + "│" + te.reset
+		fmt.Fprint(te.w, vLine)
+		for i, col := range cols {
+			pad := strings.Repeat(" ", widths[i]-len(col))
+			if i == 0 {
+				fmt.Fprintf(te.w, " %s%s %s", col, pad, vLine)
+			} else {
+				fmt.Fprintf(te.w, " %s%s %s", pad, col, vLine)
+			}
+		}
+		fmt.Fprintln(te.w)
+	}
+
+	if !te.byLangOnly {
+		fmt.Fprintln(te.w)
+	}
+	fmt.Fprintln(te.w, "By language:")
+	border("┌─", "─┬─", "─┐")
+	printRow(headers)
+	border("├─", "─┼─", "─┤")
+	for _, row := range rows {
+		printRow(row)
+	}
+	border("├─", "─┼─", "─┤")
+	printRow(totalRow)
+	border("└─", "─┴─", "─┘")
+
+	return nil
+}
+
+func (te *tableEncoder) Close() error {
+	return nil
+}
+
+// jsonFile is the per-file shape emitted inside the JSON encoder's "files"
+// array.
+type jsonFile struct {
+	Path     string `json:"path"`
+	Lang     string `json:"lang"`
+	Code     int    `json:"code"`
+	Comments int    `json:"comments"`
+	Blanks   int    `json:"blanks"`
+	Physical int    `json:"physical"`
+}
+
+// jsonLangStat is the per-language shape emitted inside the JSON encoder's
+// "by_language" array.
+type jsonLangStat struct {
+	Lang     string `json:"lang"`
+	Files    int    `json:"files"`
+	Code     int    `json:"code"`
+	Comments int    `json:"comments"`
+	Blanks   int    `json:"blanks"`
+	Physical int    `json:"physical"`
+}
+
+// jsonEncoder streams `{"files":[...],"total":N,"by_language":[...]}` one
+// file at a time, rather than buffering the whole tree into a struct before
+// marshaling it. In -by-lang mode, "files" and "total" are omitted.
+type jsonEncoder struct {
+	w          io.Writer
+	byLangOnly bool
+	wroteItem  bool
+}
 
-	slocMaxLen := intlen(total)
+func newJSONEncoder(w io.Writer, byLangOnly bool) *jsonEncoder {
+	if byLangOnly {
+		fmt.Fprint(w, `{`)
+	} else {
+		fmt.Fprint(w, `{"files":[`)
+	}
+	return &jsonEncoder{w: w, byLangOnly: byLangOnly}
+}
 
-	printItem := func(path string, sloc int) {
-		pathPad := strings.Repeat(" ", pathMaxLen-len(path))
-		slocPad := strings.Repeat(" ", slocMaxLen-intlen(sloc))
-		vLine := gray + "│" + reset
-		path = icon(filepath.Ext(path)) + path
-		fmt.Printf("%s %s%s %s %d%s %s\n", vLine, path, pathPad, vLine, sloc, slocPad, vLine)
+func (e *jsonEncoder) WriteItem(it item) error {
+	if e.wroteItem {
+		fmt.Fprint(e.w, ",")
 	}
+	e.wroteItem = true
 
-	pathHLine := strings.Repeat("─", pathMaxLen+3)
-	slocHLine := strings.Repeat("─", slocMaxLen)
-	fmt.Printf("%s┌─%s─┬─%s─┐%s\n", gray, pathHLine, slocHLine, reset)
+	b, err := json.Marshal(jsonFile{Path: it.path, Lang: it.lang, Code: it.code, Comments: it.comments, Blanks: it.blanks, Physical: it.physical})
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(b)
+	return err
+}
 
-	for _, item := range items {
-		printItem(item.path, item.sloc)
+func (e *jsonEncoder) WriteTotal(totals item) error {
+	_, err := fmt.Fprintf(e.w, `],"total":%d`, totals.code)
+	return err
+}
+
+func (e *jsonEncoder) WriteLangSummary(stats []langStat) error {
+	out := make([]jsonLangStat, len(stats))
+	for i, s := range stats {
+		out[i] = jsonLangStat{Lang: s.lang, Files: s.files, Code: s.code, Comments: s.comments, Blanks: s.blanks, Physical: s.physical}
 	}
 
-	fmt.Printf("%s├─%s─┼─%s─┤%s\n", gray, pathHLine, slocHLine, reset)
+	b, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
 
-	printItem("Total", total)
+	if e.byLangOnly {
+		_, err = fmt.Fprintf(e.w, `"by_language":%s}`, b)
+	} else {
+		_, err = fmt.Fprintf(e.w, `,"by_language":%s}`, b)
+	}
+	return err
+}
 
-	fmt.Printf("%s└─%s─┴─%s─┘%s\n", gray, pathHLine, slocHLine, reset)
+func (e *jsonEncoder) Close() error {
+	_, err := fmt.Fprintln(e.w)
+	return err
+}
+
+// delimEncoder backs both the csv and tsv formats; they differ only in the
+// field separator. In -by-lang mode, the per-file header and rows are
+// skipped and only the language summary is written.
+type delimEncoder struct {
+	w          *csv.Writer
+	byLangOnly bool
+	wroteAny   bool
+}
+
+func newDelimEncoder(w io.Writer, comma rune, byLangOnly bool) *delimEncoder {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if !byLangOnly {
+		cw.Write([]string{"path", "lang", "code", "comments", "blanks", "physical"})
+	}
+	return &delimEncoder{w: cw, byLangOnly: byLangOnly}
+}
+
+func (e *delimEncoder) WriteItem(it item) error {
+	e.wroteAny = true
+	return e.w.Write([]string{it.path, it.lang, strconv.Itoa(it.code), strconv.Itoa(it.comments), strconv.Itoa(it.blanks), strconv.Itoa(it.physical)})
+}
+
+func (e *delimEncoder) WriteTotal(totals item) error {
+	e.wroteAny = true
+	return e.w.Write([]string{"Total", "", strconv.Itoa(totals.code), strconv.Itoa(totals.comments), strconv.Itoa(totals.blanks), strconv.Itoa(totals.physical)})
+}
+
+func (e *delimEncoder) WriteLangSummary(stats []langStat) error {
+	if e.wroteAny {
+		if err := e.w.Write([]string{}); err != nil {
+			return err
+		}
+	}
+
+	if err := e.w.Write([]string{"lang", "files", "code", "comments", "blanks", "physical"}); err != nil {
+		return err
+	}
+
+	for _, s := range stats {
+		if err := e.w.Write([]string{s.lang, strconv.Itoa(s.files), strconv.Itoa(s.code), strconv.Itoa(s.comments), strconv.Itoa(s.blanks), strconv.Itoa(s.physical)}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *delimEncoder) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// isTerminal reports whether f is attached to a terminal, used to
+// auto-disable color when stdout is redirected or piped.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// toCacheItems and fromCacheItems convert between item and cache.Item, the
+// cache package's exported, JSON-friendly mirror of it.
+func toCacheItems(items []item) []cache.Item {
+	out := make([]cache.Item, len(items))
+	for i, it := range items {
+		out[i] = cache.Item{Path: it.path, Lang: it.lang, Code: it.code, Comments: it.comments, Blanks: it.blanks, Physical: it.physical}
+	}
+	return out
+}
+
+func fromCacheItems(items []cache.Item) []item {
+	out := make([]item, len(items))
+	for i, it := range items {
+		out[i] = item{path: it.Path, lang: it.Lang, code: it.Code, comments: it.Comments, blanks: it.Blanks, physical: it.Physical}
+	}
+	return out
+}
+
+// scan runs walk for root, transparently serving and populating the on-disk
+// cache unless useCache is false. refresh forces a fresh walk even when a
+// cache entry matches. The cache key folds in a hash of the effective
+// language table, so switching -L configs on an unchanged tree can't serve
+// counts produced under a different set of language definitions.
+func scan(root string, workers int, matcher *ignore.Matcher, useCache, refresh bool) ([]item, int, int, error) {
+	if !useCache {
+		return walk(root, workers, matcher)
+	}
+
+	candidates, err := collectCandidates(root, matcher)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	hash, err := cache.Hash(root, candidates)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	hash += ":lang-" + langTableHash(supported)
+
+	if !refresh {
+		if entry, ok, err := cache.Load(hash); err != nil {
+			return nil, 0, 0, err
+		} else if ok {
+			return fromCacheItems(entry.Items), entry.Total, entry.PathMaxLen, nil
+		}
+	}
+
+	items, total, pathMaxLen, err := walk(root, workers, matcher)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	if err := cache.Store(cache.Entry{
+		Hash:       hash,
+		Items:      toCacheItems(items),
+		Total:      total,
+		PathMaxLen: pathMaxLen,
+	}); err != nil {
+		return nil, 0, 0, err
+	}
+
+	return items, total, pathMaxLen, nil
 }
 
 func main() {
 	ignoreFlag := flag.String("i", "", "List of entries to ignore (comma separated)")
 	briefFlag := flag.Bool("b", false, "Print only the total")
+	jFlag := flag.Int("j", runtime.GOMAXPROCS(0), "Number of worker goroutines")
+	formatFlag := flag.String("f", "table", "Output format: table, json, csv, tsv")
+	noColorFlag := flag.Bool("no-color", false, "Disable ANSI colors regardless of format")
+	noIgnoreFlag := flag.Bool("no-ignore", false, "Don't respect .gitignore/.slocignore")
+	noCacheFlag := flag.Bool("no-cache", false, "Don't read or write the result cache")
+	refreshCacheFlag := flag.Bool("refresh-cache", false, "Re-scan and repopulate the cache even on a hit")
+	langFileFlag := flag.String("L", "", "Extra TOML file of language definitions, overriding or extending the defaults")
+	showLanguagesFlag := flag.Bool("show-languages", false, "Print the effective language table and exit")
+	detailedFlag := flag.Bool("detailed", false, "Show Comments/Blanks/Physical columns in the per-file table")
+	byLangFlag := flag.Bool("by-lang", false, "Print only the per-language summary")
 	flag.Parse()
 
-	for _, entry := range strings.Split(*ignoreFlag, ",") {
-		ignore = append(ignore, strings.TrimSpace(entry))
+	colorEnabled = !*noColorFlag && isTerminal(os.Stdout)
+
+	langs, err := loadLanguages(*langFileFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	supported = langs
+
+	if *showLanguagesFlag {
+		showLanguages(supported, os.Stdout)
+		return
 	}
 
 	root := "."
@@ -214,7 +730,26 @@ func main() {
 		root = flag.Arg(0)
 	}
 
-	items, total, pathMaxLen, err := walk(root)
+	var matcher *ignore.Matcher
+	if *noIgnoreFlag {
+		matcher = ignore.Empty(root)
+	} else {
+		var err error
+		matcher, err = ignore.New(root)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var extra []string
+	for _, entry := range strings.Split(*ignoreFlag, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			extra = append(extra, entry)
+		}
+	}
+	matcher.AddPatterns(extra)
+
+	items, total, pathMaxLen, err := scan(root, *jFlag, matcher, !*noCacheFlag, *refreshCacheFlag)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -225,7 +760,40 @@ func main() {
 
 	if *briefFlag {
 		fmt.Println(total)
-	} else {
-		print(items, total, max(len("Total"), pathMaxLen))
+		return
+	}
+
+	totals := item{code: total}
+	for _, it := range items {
+		totals.comments += it.comments
+		totals.blanks += it.blanks
+		totals.physical += it.physical
+	}
+
+	stats := aggregateByLang(items)
+
+	enc, err := newEncoder(*formatFlag, os.Stdout, totals, max(len("Total"), pathMaxLen), *detailedFlag, *byLangFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !*byLangFlag {
+		for _, it := range items {
+			if err := enc.WriteItem(it); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if err := enc.WriteTotal(totals); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := enc.WriteLangSummary(stats); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := enc.Close(); err != nil {
+		log.Fatal(err)
 	}
 }
@@ -1,7 +1,14 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
+
+	"sloc/ignore"
 )
 
 type test struct {
@@ -11,13 +18,21 @@ type test struct {
 }
 
 var tests = []test{
-	{"./tests/x.go", 6, false},
-	{"./tests/x.lua", 2, false},
-	{"./tests/x.js", 2, false},
-	{"./tests/x.css", 3, false},
-	{"./tests/x.html", 6, false},
-	{"./tests/x", 0, true},
-	{"./tests/notfound.go", 0, true},
+	{"./testdata/x.go", 6, false},
+	{"./testdata/x.lua", 2, false},
+	{"./testdata/x.js", 2, false},
+	{"./testdata/x.css", 3, false},
+	{"./testdata/x.html", 6, false},
+	{"./testdata/x", 0, true},
+	{"./testdata/notfound.go", 0, true},
+
+	// Comment markers inside string literals, and block comments that open
+	// and close on the same line as code, shouldn't be mistaken for real
+	// comments.
+	{"./testdata/tricky.go", 7, false},
+	{"./testdata/tricky.js", 3, false},
+	{"./testdata/tricky.py", 5, false},
+	{"./testdata/tricky.lua", 2, false},
 }
 
 func Test_sloc(t *testing.T) {
@@ -28,9 +43,158 @@ func Test_sloc(t *testing.T) {
 				t.Errorf("sloc() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if got != tt.want {
-				t.Errorf("sloc() = %v, want %v", got, tt.want)
+			if got.code != tt.want {
+				t.Errorf("sloc().code = %v, want %v", got.code, tt.want)
 			}
 		})
 	}
 }
+
+func Test_sloc_unsupportedExtensionSkipsRead(t *testing.T) {
+	// A nonexistent path with a known-but-unsupported extension must fail
+	// with errUnsupportedFiletype, not a read error: the extension check
+	// has to happen before the file is ever opened.
+	_, err := sloc("./testdata/notfound.png")
+	if !errors.Is(err, errUnsupportedFiletype) {
+		t.Errorf("sloc() error = %v, want errUnsupportedFiletype", err)
+	}
+}
+
+func Test_sloc_breakdown(t *testing.T) {
+	it, err := sloc("./testdata/tricky.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := item{lang: "go", code: 7, comments: 0, blanks: 1, physical: 8}
+	if it.code != want.code || it.comments != want.comments || it.blanks != want.blanks || it.physical != want.physical || it.lang != want.lang {
+		t.Errorf("sloc() = %+v, want %+v", it, want)
+	}
+}
+
+func Test_aggregateByLang(t *testing.T) {
+	items := []item{
+		{path: "a.go", lang: "go", code: 10, comments: 2, blanks: 1, physical: 13},
+		{path: "b.go", lang: "go", code: 5, comments: 0, blanks: 0, physical: 5},
+		{path: "c.py", lang: "py", code: 20, comments: 1, blanks: 2, physical: 23},
+	}
+
+	stats := aggregateByLang(items)
+	if len(stats) != 2 {
+		t.Fatalf("aggregateByLang() = %v, want 2 languages", stats)
+	}
+
+	if stats[0].lang != "py" || stats[0].files != 1 || stats[0].code != 20 {
+		t.Errorf("stats[0] = %+v, want py with code 20 (highest code, sorted first)", stats[0])
+	}
+
+	if stats[1].lang != "go" || stats[1].files != 2 || stats[1].code != 15 || stats[1].comments != 2 || stats[1].blanks != 1 || stats[1].physical != 18 {
+		t.Errorf("stats[1] = %+v, want aggregated go totals", stats[1])
+	}
+}
+
+func Test_walk_sorted(t *testing.T) {
+	items, _, _, err := walk("./testdata", 4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i < len(items); i++ {
+		if items[i-1].path > items[i].path {
+			t.Fatalf("items not sorted by path: %q before %q", items[i-1].path, items[i].path)
+		}
+	}
+}
+
+func Test_scan_cacheInvalidatesOnLangChange(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	orig := supported
+	defer func() { supported = orig }()
+
+	supported = map[string]langInfo{".go": {name: "go", inline: []string{"//"}, strDelims: []string{"\"", "'"}, escape: '\\'}}
+	items, _, _, err := scan(dir, 1, nil, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].comments != 0 {
+		t.Fatalf("scan() with package as code = %+v, want one item with 0 comments", items)
+	}
+
+	supported = map[string]langInfo{".go": {name: "go", inline: []string{"package"}, strDelims: []string{"\"", "'"}, escape: '\\'}}
+	items, _, _, err = scan(dir, 1, nil, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].comments != 1 {
+		t.Fatalf("scan() after -L reclassified \"package\" as a comment token = %+v, want one item with 1 comment; stale cache entry was served", items)
+	}
+}
+
+func Test_walk_respectsIgnore(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFile := func(rel, content string) {
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeFile(".gitignore", "vendor/\n")
+	writeFile("main.go", "package main\n")
+	writeFile("vendor/dep.go", "package dep\n")
+
+	matcher, err := ignore.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, _, _, err := walk(dir, 2, matcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 1 || items[0].path != "main.go" {
+		t.Fatalf("walk() = %v, want only main.go", items)
+	}
+}
+
+// genTree writes n small .go files across a handful of subdirectories of dir,
+// for use as a synthetic tree in BenchmarkWalk.
+func genTree(tb testing.TB, dir string, n int) {
+	tb.Helper()
+
+	const content = "package pkg\n\nfunc F() {}\n"
+
+	for i := 0; i < n; i++ {
+		sub := filepath.Join(dir, fmt.Sprintf("pkg%d", i%50))
+		if err := os.MkdirAll(sub, 0o755); err != nil {
+			tb.Fatal(err)
+		}
+		path := filepath.Join(sub, fmt.Sprintf("file%d.go", i))
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWalk(b *testing.B) {
+	dir := b.TempDir()
+	genTree(b, dir, 3000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := walk(dir, runtime.GOMAXPROCS(0), nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+package main
+
+func main() {
+	s := `this has
+// fake comment
+and /* fake block */ inside`
+	println(s)
+}
@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+// comment line
+var x = 1
+func main() {
+fmt.Println("hi")
+}